@@ -0,0 +1,153 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// Mutation is a single row-level change delivered by a changefeed,
+// destined for table beneath some endpoint's database.
+type Mutation struct {
+	endpoint string
+	database string
+	table    string
+	key      string
+	value    []byte
+	// deleted marks this mutation as a delete of key rather than an
+	// upsert of key/value.
+	deleted bool
+}
+
+// endpoints records the apply mode negotiated for each endpoint at
+// registration time. Transactional endpoints stage mutations until a
+// resolved timestamp arrives; immediate endpoints apply them as they
+// arrive instead.
+var endpoints = struct {
+	sync.RWMutex
+	immediate map[string]bool
+}{immediate: make(map[string]bool)}
+
+// RegisterEndpoint records whether endpoint should apply mutations
+// immediately as they arrive, or stage them until a resolved timestamp
+// is received. This is intended to be called once, when an endpoint is
+// first configured.
+func RegisterEndpoint(endpoint string, immediate bool) {
+	endpoints.Lock()
+	defer endpoints.Unlock()
+	endpoints.immediate[endpoint] = immediate
+}
+
+// isImmediate reports whether endpoint was registered for immediate
+// apply. Endpoints that were never explicitly registered default to the
+// transactional, staged behavior.
+func isImmediate(endpoint string) bool {
+	endpoints.RLock()
+	defer endpoints.RUnlock()
+	return endpoints.immediate[endpoint]
+}
+
+// databaseKey identifies the tables staged beneath one endpoint's target
+// database, since a single endpoint now fans out to every table under
+// that database rather than a single sink table.
+type databaseKey struct {
+	endpoint string
+	database string
+}
+
+// staged holds mutations that have arrived for a transactional endpoint's
+// database but have not yet been flushed to their target tables.
+var staged = struct {
+	sync.Mutex
+	byDatabase map[databaseKey][]Mutation
+}{byDatabase: make(map[databaseKey][]Mutation)}
+
+// stageMutation records m for later application, unless its endpoint is
+// configured for immediate apply, in which case m is applied to its
+// target table right away.
+func stageMutation(tx *sql.Tx, m Mutation) error {
+	if isImmediate(m.endpoint) {
+		return applyMutation(tx, m)
+	}
+	key := databaseKey{endpoint: m.endpoint, database: m.database}
+	staged.Lock()
+	staged.byDatabase[key] = append(staged.byDatabase[key], m)
+	staged.Unlock()
+	return nil
+}
+
+// sinkRowColumns are the columns applyMutation actually writes to a
+// target table: a mutation's value is always applied opaquely, so
+// compatibility checks must be made against the fixed key/value shape
+// applyMutation writes, not against whatever fields happen to appear in
+// an upstream payload.
+var sinkRowColumns = []string{"key", "value"}
+
+// applyMutation applies a single mutation to its target table: a delete
+// of m.key if m.deleted, otherwise an upsert of m.key/m.value.
+func applyMutation(tx *sql.Tx, m Mutation) error {
+	if m.deleted {
+		_, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s.%s WHERE key = $1`, m.database, m.table), m.key)
+		return err
+	}
+	_, err := tx.Exec(fmt.Sprintf(`UPSERT INTO %s.%s (key, value) VALUES ($1, $2)`, m.database, m.table),
+		m.key, m.value)
+	return err
+}
+
+// flushStaged applies and discards every mutation staged across every
+// table beneath (endpoint, database), as a single per-database flush. For
+// an immediate endpoint this is a no-op: its mutations were already
+// applied to their target tables as they arrived, so there is nothing
+// left to flush.
+func flushStaged(tx *sql.Tx, endpoint, database string) error {
+	if isImmediate(endpoint) {
+		return nil
+	}
+
+	key := databaseKey{endpoint: endpoint, database: database}
+	staged.Lock()
+	pending := staged.byDatabase[key]
+	delete(staged.byDatabase, key)
+	staged.Unlock()
+
+	for _, m := range pending {
+		if err := applyMutation(tx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleResolvedLine is invoked when a resolved-timestamp line arrives
+// for rl.endpoint's database. Before flushing, it checks that everything
+// staged beneath that database is compatible with its tables' current
+// schema; if not, the changefeed is paused for that (endpoint, database)
+// pair by returning an error without advancing its resolved row, so the
+// next resolved line received will retry the same check. Otherwise it
+// flushes every table staged beneath the database atomically and
+// advances the endpoint's high-water mark, regardless of apply mode: the
+// resolved row is always updated so that restart positioning and
+// observability keep working even when staging itself is bypassed.
+func HandleResolvedLine(tx *sql.Tx, rl ResolvedLine) error {
+	if err := CheckCompatible(tx, rl.endpoint, rl.database); err != nil {
+		markPaused(rl.endpoint, rl.database, err.Error())
+		return err
+	}
+	clearPaused(rl.endpoint, rl.database)
+	if err := flushStaged(tx, rl.endpoint, rl.database); err != nil {
+		return err
+	}
+	rl.immediate = isImmediate(rl.endpoint)
+	return rl.writeUpdated(tx)
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+)
+
+// TestResolvedTableMixedMode exercises two endpoints sharing the same
+// _cdc_sink database, one registered for immediate apply and one left
+// transactional, and verifies that an immediate endpoint's mutations
+// land in the target table as they arrive while a transactional
+// endpoint's mutations only land once its resolved line is handled.
+func TestResolvedTableMixedMode(t *testing.T) {
+	db, _, dbClose := getDB(t)
+	defer dbClose()
+
+	createSinkDB(t, db)
+	defer dropSinkDB(t, db)
+
+	if err := CreateResolvedTable(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.target (key STRING PRIMARY KEY, value BYTES)`, sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterEndpoint("immediate", true)
+	RegisterEndpoint("transactional", false)
+
+	withTx := func(f func(tx *sql.Tx) error) {
+		if err := crdb.ExecuteTx(context.Background(), db, nil, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stage a mutation for each endpoint.
+	withTx(func(tx *sql.Tx) error {
+		if err := stageMutation(tx, Mutation{endpoint: "immediate", database: sinkDBName, table: "target", key: "a", value: []byte("1")}); err != nil {
+			return err
+		}
+		return stageMutation(tx, Mutation{endpoint: "transactional", database: sinkDBName, table: "target", key: "b", value: []byte("2")})
+	})
+
+	// The immediate mutation should already be visible; the
+	// transactional one should not.
+	if count := getRowCount(t, db, fmt.Sprintf("%s.target", sinkDBName)); count != 1 {
+		t.Fatalf("expected 1 row after staging, got %d", count)
+	}
+
+	// Handling a resolved line for the transactional endpoint flushes
+	// its staged mutation.
+	withTx(func(tx *sql.Tx) error {
+		return HandleResolvedLine(tx, ResolvedLine{endpoint: "transactional", database: sinkDBName, nanos: 1, logical: 0})
+	})
+	if count := getRowCount(t, db, fmt.Sprintf("%s.target", sinkDBName)); count != 2 {
+		t.Fatalf("expected 2 rows after flush, got %d", count)
+	}
+
+	// Handling a resolved line for the immediate endpoint is a no-op
+	// for staging, but still advances its high-water mark.
+	withTx(func(tx *sql.Tx) error {
+		return HandleResolvedLine(tx, ResolvedLine{endpoint: "immediate", database: sinkDBName, nanos: 1, logical: 0})
+	})
+
+	immediate, err := getPreviousResolvedDB(db, "immediate", sinkDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !immediate.immediate {
+		t.Errorf("expected immediate endpoint's resolved row to record immediate=true")
+	}
+
+	transactional, err := getPreviousResolvedDB(db, "transactional", sinkDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transactional.immediate {
+		t.Errorf("expected transactional endpoint's resolved row to record immediate=false")
+	}
+}
+
+// TestResolvedTableMultiTableFlush verifies that one resolved line for an
+// (endpoint, database) pair flushes every table with mutations staged
+// beneath it, not just one: a single database row is keyed on
+// (endpoint, database) and fans out to however many tables that
+// database has, so a single HandleResolvedLine call must apply all of
+// them atomically.
+func TestResolvedTableMultiTableFlush(t *testing.T) {
+	db, _, dbClose := getDB(t)
+	defer dbClose()
+
+	createSinkDB(t, db)
+	defer dropSinkDB(t, db)
+
+	if err := CreateResolvedTable(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.target_a (key STRING PRIMARY KEY, value BYTES)`, sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.target_b (key STRING PRIMARY KEY, value BYTES)`, sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+
+	RegisterEndpoint("multi-table", false)
+
+	withTx := func(f func(tx *sql.Tx) error) {
+		if err := crdb.ExecuteTx(context.Background(), db, nil, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Stage mutations against two different tables under the same
+	// (endpoint, database) pair.
+	withTx(func(tx *sql.Tx) error {
+		if err := stageMutation(tx, Mutation{endpoint: "multi-table", database: sinkDBName, table: "target_a", key: "a", value: []byte("1")}); err != nil {
+			return err
+		}
+		return stageMutation(tx, Mutation{endpoint: "multi-table", database: sinkDBName, table: "target_b", key: "b", value: []byte("2")})
+	})
+
+	if count := getRowCount(t, db, fmt.Sprintf("%s.target_a", sinkDBName)); count != 0 {
+		t.Fatalf("expected 0 rows in target_a before flush, got %d", count)
+	}
+	if count := getRowCount(t, db, fmt.Sprintf("%s.target_b", sinkDBName)); count != 0 {
+		t.Fatalf("expected 0 rows in target_b before flush, got %d", count)
+	}
+
+	// A single resolved line for the shared (endpoint, database) pair
+	// must flush both tables.
+	withTx(func(tx *sql.Tx) error {
+		return HandleResolvedLine(tx, ResolvedLine{endpoint: "multi-table", database: sinkDBName, nanos: 1, logical: 0})
+	})
+
+	if count := getRowCount(t, db, fmt.Sprintf("%s.target_a", sinkDBName)); count != 1 {
+		t.Fatalf("expected 1 row in target_a after flush, got %d", count)
+	}
+	if count := getRowCount(t, db, fmt.Sprintf("%s.target_b", sinkDBName)); count != 1 {
+		t.Fatalf("expected 1 row in target_b after flush, got %d", count)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+//go:build db2
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DB2StagingTable maps one DB2 ASN CDC capture/staging table to the
+// sink table it should be replicated into.
+type DB2StagingTable struct {
+	// Capture is the name of the DB2 ASN capture (staging) table, e.g.
+	// "CD_EMPLOYEE".
+	Capture string
+	// Target is the name of the table, beneath the connector's
+	// database, that rows from Capture should be applied to.
+	Target string
+	// KeyColumn is the business column of Capture that identifies a row,
+	// e.g. "ID". It must name a column that is not one of
+	// db2MetadataColumns.
+	KeyColumn string
+}
+
+// db2MetadataColumns are ASN capture bookkeeping columns that describe a
+// staged row rather than being part of its business data. They are
+// excluded from a Mutation's value.
+var db2MetadataColumns = map[string]bool{
+	"IBMSNAP_COMMITSEQ": true,
+	"IBMSNAP_INTENTSEQ": true,
+	"IBMSNAP_OPERATION": true,
+	"IBMSNAP_UOWID":     true,
+}
+
+// DB2Connector implements SourceConnector by polling a set of DB2 ASN CDC
+// staging tables on an interval. It has no equivalent of a native
+// resolved-timestamp line, so it synthesizes one from the maximum DB2 log
+// sequence number (LSN) observed across all staging tables in a poll,
+// which existing writeUpdated/getPreviousResolved restart positioning
+// then treats exactly like a CRDB resolved timestamp.
+type DB2Connector struct {
+	db       *sql.DB
+	endpoint string
+	database string
+	tables   []DB2StagingTable
+	interval time.Duration
+
+	// lastSeq is the highest IBMSNAP_COMMITSEQ already consumed from
+	// each staging table, used both to avoid re-reading rows and to
+	// resume correctly after a restart.
+	lastSeq map[string][]byte
+}
+
+// NewDB2Connector returns a DB2Connector that polls tables on db every
+// interval.
+func NewDB2Connector(db *sql.DB, endpoint, database string, tables []DB2StagingTable, interval time.Duration) *DB2Connector {
+	return &DB2Connector{
+		db:       db,
+		endpoint: endpoint,
+		database: database,
+		tables:   tables,
+		interval: interval,
+		lastSeq:  make(map[string][]byte),
+	}
+}
+
+// Next implements SourceConnector. It blocks for interval, polls every
+// configured staging table for rows newer than the last one consumed,
+// and returns them alongside a synthetic resolved line derived from the
+// maximum commit sequence observed across all tables in this poll.
+func (c *DB2Connector) Next(ctx context.Context) ([]Mutation, ResolvedLine, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ResolvedLine{}, ctx.Err()
+	case <-time.After(c.interval):
+	}
+
+	var mutations []Mutation
+	var maxSeq []byte
+
+	for _, st := range c.tables {
+		rows, err := c.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT *
+FROM %s
+WHERE IBMSNAP_COMMITSEQ > ?
+ORDER BY IBMSNAP_COMMITSEQ ASC`, st.Capture), c.lastSeq[st.Capture])
+		if err != nil {
+			return nil, ResolvedLine{}, fmt.Errorf("polling %s: %w", st.Capture, err)
+		}
+
+		cols, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, ResolvedLine{}, err
+		}
+
+		for rows.Next() {
+			dest := make([]interface{}, len(cols))
+			for i := range dest {
+				dest[i] = new(interface{})
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return nil, ResolvedLine{}, err
+			}
+
+			row := make(map[string]interface{}, len(cols))
+			for i, col := range cols {
+				row[col] = *dest[i].(*interface{})
+			}
+
+			seq, _ := row["IBMSNAP_COMMITSEQ"].([]byte)
+			if bytes.Compare(seq, maxSeq) > 0 {
+				maxSeq = seq
+			}
+			c.lastSeq[st.Capture] = seq
+
+			operation, _ := row["IBMSNAP_OPERATION"].(string)
+			mutation, err := mutationFromDB2Row(c.endpoint, c.database, st, operation, row)
+			if err != nil {
+				rows.Close()
+				return nil, ResolvedLine{}, err
+			}
+			mutations = append(mutations, mutation)
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, ResolvedLine{}, err
+		}
+		rows.Close()
+	}
+
+	if maxSeq == nil {
+		return mutations, ResolvedLine{}, nil
+	}
+
+	return mutations, ResolvedLine{
+		endpoint: c.endpoint,
+		database: c.database,
+		nanos:    lsnToNanos(maxSeq),
+		logical:  0,
+	}, nil
+}
+
+// mutationFromDB2Row assembles a Mutation from one DB2 ASN capture row.
+// The row's key comes from st.KeyColumn, configured per staging table
+// rather than inferred from map iteration order. A 'D' operation
+// produces a delete of that key; otherwise the row's business columns
+// (everything but db2MetadataColumns) are serialized as JSON into the
+// mutation's value, mirroring how parseMutationLine carries a CRDB
+// changefeed's "after" payload through unparsed.
+func mutationFromDB2Row(endpoint, database string, st DB2StagingTable, operation string, row map[string]interface{}) (Mutation, error) {
+	m := Mutation{
+		endpoint: endpoint,
+		database: database,
+		table:    st.Target,
+		key:      fmt.Sprintf("%v", row[st.KeyColumn]),
+		deleted:  operation == "D",
+	}
+	if m.deleted {
+		return m, nil
+	}
+
+	fields := make(map[string]interface{}, len(row))
+	for col, val := range row {
+		if db2MetadataColumns[col] {
+			continue
+		}
+		fields[col] = val
+	}
+	value, err := json.Marshal(fields)
+	if err != nil {
+		return Mutation{}, fmt.Errorf("could not serialize row for %s: %w", st.Capture, err)
+	}
+	m.value = value
+	return m, nil
+}
+
+// lsnToNanos derives a monotonically increasing nanos value from a DB2
+// LSN so that the existing resolved-table restart-positioning logic,
+// which orders purely on (nanos, logical), can be reused unmodified for
+// DB2 sources. A DB2 ASN IBMSNAP_COMMITSEQ is conventionally 10 bytes,
+// wider than the int64 nanos field; only the low 8 bytes, which carry
+// the increasing part of the sequence, are kept.
+func lsnToNanos(lsn []byte) int64 {
+	if len(lsn) > 8 {
+		lsn = lsn[len(lsn)-8:]
+	}
+	padded := make([]byte, 8)
+	copy(padded[8-len(lsn):], lsn)
+	return int64(binary.BigEndian.Uint64(padded))
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// testConnString is the insecure, default-user connection string these
+// tests expect a local cockroach server to be listening on.
+const testConnString = "postgresql://root@localhost:26257?sslmode=disable"
+
+// getDB opens a connection to the test cluster, returning the database
+// handle, the name of a freshly created scratch database, and a closer
+// that tears both down.
+func getDB(t *testing.T) (*sql.DB, string, func()) {
+	db, err := sql.Open("postgres", testConnString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbName := "_test_db"
+	if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", dbName)); err != nil {
+		t.Fatal(err)
+	}
+
+	return db, dbName, func() {
+		if _, err := db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", dbName)); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	}
+}
+
+// createSinkDB creates the _cdc_sink bookkeeping database used by the
+// resolved-timestamp table.
+func createSinkDB(t *testing.T, db *sql.DB) {
+	if _, err := db.Exec(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s", sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dropSinkDB drops the _cdc_sink bookkeeping database.
+func dropSinkDB(t *testing.T, db *sql.DB) {
+	if _, err := db.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s CASCADE", sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// getRowCount returns the number of rows currently present in table.
+func getRowCount(t *testing.T, db *sql.DB, table string) int {
+	var count int
+	if err := db.QueryRow(fmt.Sprintf("SELECT count(*) FROM %s", table)).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+// Command cdc-sink accepts CockroachDB changefeed webhook payloads and
+// applies them to a target database.
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+	conn := flag.String("conn", "postgresql://root@localhost:26257?sslmode=disable", "sink database connection string")
+	addr := flag.String("addr", ":26258", "address to listen on for changefeed webhooks")
+	immediateEndpoints := flag.String("immediate-endpoints", "",
+		"comma-separated list of endpoints to apply immediately instead of staging until resolved")
+	flag.Parse()
+
+	db, err := sql.Open("postgres", *conn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := CreateResolvedTable(db); err != nil {
+		log.Fatal(err)
+	}
+
+	for _, endpoint := range strings.Split(*immediateEndpoints, ",") {
+		if endpoint != "" {
+			RegisterEndpoint(endpoint, true)
+		}
+	}
+
+	http.Handle("/_/status", StatusHandler(db))
+	http.Handle("/_/metrics", promhttp.Handler())
+	http.HandleFunc("/", changefeedHandler(db))
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sinkDBName is the name of the database cdc-sink uses for its own
+// bookkeeping tables.
+const sinkDBName = "_cdc_sink"
+
+// resolvedTableName is the name of the table that tracks the last
+// resolved timestamp applied for each endpoint.
+const resolvedTableName = "resolved_timestamps"
+
+// resolvedFullTableName returns the fully qualified name of the resolved
+// timestamp table.
+func resolvedFullTableName() string {
+	return fmt.Sprintf("%s.%s", sinkDBName, resolvedTableName)
+}
+
+// ResolvedLine represents a single resolved-timestamp line emitted by a
+// CockroachDB changefeed, along with the endpoint it was received on. An
+// endpoint names an entire target database: a single resolved timestamp
+// advances every table beneath that database together.
+type ResolvedLine struct {
+	endpoint string
+	database string
+	nanos    int64
+	logical  int
+	// immediate records whether endpoint was negotiated for immediate
+	// apply at registration time. It rides along on the resolved row
+	// purely for observability; it does not affect how this particular
+	// line is parsed.
+	immediate bool
+}
+
+// CreateResolvedTable creates the resolved-timestamp bookkeeping table if
+// it does not already exist.
+func CreateResolvedTable(db *sql.DB) error {
+	_, err := db.Exec(fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+	endpoint  STRING NOT NULL,
+	database  STRING NOT NULL,
+	nanos     INT NOT NULL,
+	logical   INT NOT NULL,
+	immediate BOOL NOT NULL DEFAULT false,
+	PRIMARY KEY (endpoint, database)
+)`, resolvedFullTableName()))
+	return err
+}
+
+// parseResolvedLine parses a single line of a CockroachDB changefeed's
+// resolved-timestamp payload, of the form
+// {"resolved": "<nanos>.<logical>"}, and attaches the endpoint and target
+// database the line was received for.
+func parseResolvedLine(line []byte, endpoint, database string) (ResolvedLine, error) {
+	var payload struct {
+		Resolved string `json:"resolved"`
+	}
+	if err := json.Unmarshal(line, &payload); err != nil {
+		return ResolvedLine{}, fmt.Errorf("could not parse resolved line: %w", err)
+	}
+	if payload.Resolved == "" {
+		return ResolvedLine{}, fmt.Errorf("resolved line missing resolved field")
+	}
+
+	parts := strings.SplitN(payload.Resolved, ".", 2)
+	if len(parts) != 2 {
+		return ResolvedLine{}, fmt.Errorf("malformed resolved timestamp: %s", payload.Resolved)
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ResolvedLine{}, fmt.Errorf("could not parse nanos: %w", err)
+	}
+	if nanos == 0 {
+		return ResolvedLine{}, fmt.Errorf("resolved timestamp must be non-zero")
+	}
+	logical, err := strconv.Atoi(strings.TrimLeft(parts[1], "0"))
+	if err != nil && strings.Trim(parts[1], "0") != "" {
+		return ResolvedLine{}, fmt.Errorf("could not parse logical: %w", err)
+	}
+
+	return ResolvedLine{
+		endpoint: endpoint,
+		database: database,
+		nanos:    nanos,
+		logical:  logical,
+	}, nil
+}
+
+// writeUpdated upserts this resolved line into the resolved-timestamp
+// table, replacing whatever value was previously recorded for its
+// (endpoint, database) pair.
+func (rl ResolvedLine) writeUpdated(tx *sql.Tx) error {
+	_, err := tx.Exec(fmt.Sprintf(`
+UPSERT INTO %s (endpoint, database, nanos, logical, immediate) VALUES ($1, $2, $3, $4, $5)`,
+		resolvedFullTableName()),
+		rl.endpoint, rl.database, rl.nanos, rl.logical, rl.immediate)
+	if err != nil {
+		return err
+	}
+	updateResolvedMetrics(rl)
+	return nil
+}
+
+// getPreviousResolved returns the last resolved line recorded for the
+// given (endpoint, database) pair, or the zero-valued ResolvedLine for
+// that pair if none has been recorded yet.
+func getPreviousResolved(tx *sql.Tx, endpoint, database string) (ResolvedLine, error) {
+	rl := ResolvedLine{endpoint: endpoint, database: database}
+	row := tx.QueryRow(fmt.Sprintf(`
+SELECT nanos, logical, immediate FROM %s WHERE endpoint = $1 AND database = $2`,
+		resolvedFullTableName()), endpoint, database)
+	if err := row.Scan(&rl.nanos, &rl.logical, &rl.immediate); err != nil {
+		if err == sql.ErrNoRows {
+			return rl, nil
+		}
+		return ResolvedLine{}, err
+	}
+	return rl, nil
+}
+
+// getAllResolved returns every resolved row currently recorded, across
+// all endpoint/database pairs.
+func getAllResolved(tx *sql.Tx) ([]ResolvedLine, error) {
+	rows, err := tx.Query(fmt.Sprintf(`
+SELECT endpoint, database, nanos, logical, immediate FROM %s`, resolvedFullTableName()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []ResolvedLine
+	for rows.Next() {
+		var rl ResolvedLine
+		if err := rows.Scan(&rl.endpoint, &rl.database, &rl.nanos, &rl.logical, &rl.immediate); err != nil {
+			return nil, err
+		}
+		all = append(all, rl)
+	}
+	return all, rows.Err()
+}
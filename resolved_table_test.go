@@ -28,11 +28,11 @@ func (rl ResolvedLine) writeUpdatedDB(db *sql.DB) error {
 	})
 }
 
-func getPreviousResolvedDB(db *sql.DB, endpoint string) (ResolvedLine, error) {
+func getPreviousResolvedDB(db *sql.DB, endpoint, database string) (ResolvedLine, error) {
 	var resolvedLine ResolvedLine
 	if err := crdb.ExecuteTx(context.Background(), db, nil, func(tx *sql.Tx) error {
 		var err error
-		resolvedLine, err = getPreviousResolved(tx, endpoint)
+		resolvedLine, err = getPreviousResolved(tx, endpoint, database)
 		return err
 	}); err != nil {
 		return ResolvedLine{}, err
@@ -47,28 +47,29 @@ func TestParseResolvedLine(t *testing.T) {
 		expectedNanos    int64
 		expectedLogical  int
 		expectedEndpoint string
+		expectedDatabase string
 	}{
 		{
 			`{"resolved": "1586020760120222000.0000000000"}`,
-			true, 1586020760120222000, 0, "endpoint.sql",
+			true, 1586020760120222000, 0, "endpoint.sql", "db1",
 		},
 		{
 			`{}`,
-			false, 0, 0, "",
+			false, 0, 0, "", "",
 		},
 		{
 			`"resolved": "1586020760120222000"}`,
-			false, 0, 0, "",
+			false, 0, 0, "", "",
 		},
 		{
 			`{"resolved": "0.0000000000"}`,
-			false, 0, 0, "",
+			false, 0, 0, "", "",
 		},
 	}
 
 	for i, test := range tests {
 		t.Run(fmt.Sprintf("%d - %s", i, test.testcase), func(t *testing.T) {
-			actual, actualErr := parseResolvedLine([]byte(test.testcase), "endpoint.sql")
+			actual, actualErr := parseResolvedLine([]byte(test.testcase), "endpoint.sql", "db1")
 			if test.expectedPass == (actualErr != nil) {
 				t.Errorf("Expected %v, got %s", test.expectedPass, actualErr)
 			}
@@ -84,6 +85,9 @@ func TestParseResolvedLine(t *testing.T) {
 			if test.expectedEndpoint != actual.endpoint {
 				t.Errorf("Expected %s endpoint, got %s endpoint", test.expectedEndpoint, actual.endpoint)
 			}
+			if test.expectedDatabase != actual.database {
+				t.Errorf("Expected %s database, got %s database", test.expectedDatabase, actual.database)
+			}
 		})
 	}
 }
@@ -105,6 +109,9 @@ func TestResolvedTable(t *testing.T) {
 		if e.endpoint != a.endpoint {
 			t.Errorf("Expected endpoint: %s, actual: %s", e.endpoint, a.endpoint)
 		}
+		if e.database != a.database {
+			t.Errorf("Expected database: %s, actual: %s", e.database, a.database)
+		}
 		if e.nanos != a.nanos {
 			t.Errorf("Expected nanos: %d, actual: %d", e.nanos, a.nanos)
 		}
@@ -118,24 +125,25 @@ func TestResolvedTable(t *testing.T) {
 		t.Fatalf("Expected 0 rows, got %d", rowCount)
 	}
 
-	// Find no previous value for endpoint "one".
-	one, err := getPreviousResolvedDB(db, "one")
+	// Find no previous value for endpoint "one", database "db".
+	one, err := getPreviousResolvedDB(db, "one", "db")
 	if err != nil {
 		t.Fatal(err)
 	}
-	checkResolved(ResolvedLine{endpoint: "one"}, one)
+	checkResolved(ResolvedLine{endpoint: "one", database: "db"}, one)
 
 	// Push 10 updates rows to the resolved table and check each one.
 	for i := 0; i < 10; i++ {
 		newOne := ResolvedLine{
 			endpoint: "one",
+			database: "db",
 			nanos:    int64(i),
 			logical:  i,
 		}
 		if err := newOne.writeUpdatedDB(db); err != nil {
 			t.Fatal(err)
 		}
-		previousOne, err := getPreviousResolvedDB(db, "one")
+		previousOne, err := getPreviousResolvedDB(db, "one", "db")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -143,23 +151,24 @@ func TestResolvedTable(t *testing.T) {
 	}
 
 	// Now do the same for a second endpoint.
-	two, err := getPreviousResolvedDB(db, "two")
+	two, err := getPreviousResolvedDB(db, "two", "db")
 	if err != nil {
 		t.Fatal(err)
 	}
-	checkResolved(ResolvedLine{endpoint: "two"}, two)
+	checkResolved(ResolvedLine{endpoint: "two", database: "db"}, two)
 
 	// Push 10 updates rows to the resolved table and check each one.
 	for i := 0; i < 10; i++ {
 		newOne := ResolvedLine{
 			endpoint: "two",
+			database: "db",
 			nanos:    int64(i),
 			logical:  i,
 		}
 		if err := newOne.writeUpdatedDB(db); err != nil {
 			t.Fatal(err)
 		}
-		previousOne, err := getPreviousResolvedDB(db, "two")
+		previousOne, err := getPreviousResolvedDB(db, "two", "db")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -169,8 +178,9 @@ func TestResolvedTable(t *testing.T) {
 	// Now intersperse the updates.
 	for i := 100; i < 120; i++ {
 		newResolved := ResolvedLine{
-			nanos:   int64(i),
-			logical: i,
+			database: "db",
+			nanos:    int64(i),
+			logical:  i,
 		}
 		if i%2 == 0 {
 			newResolved.endpoint = "one"
@@ -181,7 +191,7 @@ func TestResolvedTable(t *testing.T) {
 		if err := newResolved.writeUpdatedDB(db); err != nil {
 			t.Fatal(err)
 		}
-		previousResolved, err := getPreviousResolvedDB(db, newResolved.endpoint)
+		previousResolved, err := getPreviousResolvedDB(db, newResolved.endpoint, "db")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -193,4 +203,29 @@ func TestResolvedTable(t *testing.T) {
 	if rowCount := getRowCount(t, db, resolvedFullTableName()); rowCount != 2 {
 		t.Fatalf("Expected 2 rows, got %d", rowCount)
 	}
+
+	// An endpoint that fans out to a second database gets its own
+	// resolved row, since a row is keyed on (endpoint, database), not on
+	// endpoint alone.
+	oneOtherDB := ResolvedLine{endpoint: "one", database: "otherdb", nanos: 5, logical: 0}
+	if err := oneOtherDB.writeUpdatedDB(db); err != nil {
+		t.Fatal(err)
+	}
+	previousOneOtherDB, err := getPreviousResolvedDB(db, "one", "otherdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResolved(oneOtherDB, previousOneOtherDB)
+
+	previousOneDB, err := getPreviousResolvedDB(db, "one", "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previousOneDB.nanos == oneOtherDB.nanos && previousOneDB.database == oneOtherDB.database {
+		t.Fatalf("expected endpoint 'one' under database 'db' to be unaffected by the write to 'otherdb'")
+	}
+
+	if rowCount := getRowCount(t, db, resolvedFullTableName()); rowCount != 3 {
+		t.Fatalf("Expected 3 rows, got %d", rowCount)
+	}
 }
@@ -0,0 +1,139 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schemaRefreshInterval controls how often a cached target schema is
+// reloaded from the database even absent a detected mismatch.
+const schemaRefreshInterval = 30 * time.Second
+
+// columnKey identifies a target table by its database and table name.
+type columnKey struct {
+	database string
+	table    string
+}
+
+// cachedSchema is the set of column names known for a target table, plus
+// when that set was last loaded.
+type cachedSchema struct {
+	columns map[string]bool
+	loadAt  time.Time
+}
+
+// targetSchemas caches the columns present on each target table so that
+// compatibility checks do not need to hit information_schema on every
+// flush.
+var targetSchemas = struct {
+	sync.Mutex
+	byTable map[columnKey]cachedSchema
+}{byTable: make(map[columnKey]cachedSchema)}
+
+// loadSchema reads the current columns of database.table from
+// information_schema, caching the result for schemaRefreshInterval.
+func loadSchema(tx *sql.Tx, database, table string) (map[string]bool, error) {
+	key := columnKey{database: database, table: table}
+
+	targetSchemas.Lock()
+	cached, ok := targetSchemas.byTable[key]
+	targetSchemas.Unlock()
+	if ok && time.Since(cached.loadAt) < schemaRefreshInterval {
+		return cached.columns, nil
+	}
+
+	rows, err := tx.Query(`
+SELECT column_name FROM information_schema.columns
+WHERE table_catalog = $1 AND table_name = $2`, database, table)
+	if err != nil {
+		return nil, fmt.Errorf("could not load schema for %s.%s: %w", database, table, err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	targetSchemas.Lock()
+	targetSchemas.byTable[key] = cachedSchema{columns: columns, loadAt: time.Now()}
+	targetSchemas.Unlock()
+
+	return columns, nil
+}
+
+// invalidateSchema discards any cached schema for database.table, forcing
+// the next loadSchema call to reload it from information_schema.
+func invalidateSchema(database, table string) {
+	targetSchemas.Lock()
+	delete(targetSchemas.byTable, columnKey{database: database, table: table})
+	targetSchemas.Unlock()
+}
+
+// CheckCompatible verifies that every table with mutations currently
+// staged beneath (endpoint, database) actually has the columns
+// applyMutation is about to write (sinkRowColumns), not whatever
+// upstream field names happen to appear in the staged payloads. It is
+// called before a resolved timestamp is allowed to advance so that
+// schema drift pauses the changefeed for that (endpoint, database) pair
+// instead of flushing into a table that can't yet accept the write.
+func CheckCompatible(tx *sql.Tx, endpoint, database string) error {
+	key := databaseKey{endpoint: endpoint, database: database}
+	staged.Lock()
+	pending := append([]Mutation(nil), staged.byDatabase[key]...)
+	staged.Unlock()
+
+	checked := make(map[columnKey]bool)
+	for _, m := range pending {
+		tableKey := columnKey{database: m.database, table: m.table}
+		if checked[tableKey] {
+			continue
+		}
+		checked[tableKey] = true
+
+		target, err := loadSchema(tx, m.database, m.table)
+		if err != nil {
+			return err
+		}
+		for _, col := range sinkRowColumns {
+			if !target[col] {
+				invalidateSchema(m.database, m.table)
+				return fmt.Errorf("endpoint %q paused: column %q not present on %s.%s (have: %s)",
+					endpoint, col, m.database, m.table, strings.Join(sortedKeys(target), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in sorted order, for deterministic
+// error messages.
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+)
+
+// TestSchemaDriftPausesResolved verifies that a mutation staged against a
+// target table that is missing one of the columns applyMutation actually
+// writes (sinkRowColumns) prevents the resolved row from advancing, and
+// that the feed resumes once the missing column is added. The mutation
+// is produced by parseMutationLine, the same parser the real ingestion
+// path uses, so the check is exercised against a real payload rather
+// than a hand-crafted one.
+func TestSchemaDriftPausesResolved(t *testing.T) {
+	db, _, dbClose := getDB(t)
+	defer dbClose()
+
+	createSinkDB(t, db)
+	defer dropSinkDB(t, db)
+
+	if err := CreateResolvedTable(db); err != nil {
+		t.Fatal(err)
+	}
+	// The target is missing the "value" column that applyMutation needs.
+	if _, err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s.drift_target (key STRING PRIMARY KEY)`, sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+	invalidateSchema(sinkDBName, "drift_target")
+
+	RegisterEndpoint("drift", false)
+
+	withTx := func(f func(tx *sql.Tx) error) error {
+		return crdb.ExecuteTx(context.Background(), db, nil, f)
+	}
+
+	m, err := parseMutationLine([]byte(`{"after": {"id": 1, "name": "Ada"}, "key": ["1"]}`),
+		"drift", sinkDBName, "drift_target")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := withTx(func(tx *sql.Tx) error {
+		return stageMutation(tx, m)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A resolved line should be rejected and must not advance the row.
+	err = withTx(func(tx *sql.Tx) error {
+		return HandleResolvedLine(tx, ResolvedLine{endpoint: "drift", database: sinkDBName, nanos: 1, logical: 0})
+	})
+	if err == nil {
+		t.Fatal("expected schema drift to pause the endpoint")
+	}
+
+	resolved, err := getPreviousResolvedDB(db, "drift", sinkDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.nanos != 0 {
+		t.Fatalf("expected resolved row not to advance, got nanos=%d", resolved.nanos)
+	}
+
+	// Add the missing column; the next resolved line should succeed.
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s.drift_target ADD COLUMN value BYTES`, sinkDBName)); err != nil {
+		t.Fatal(err)
+	}
+	invalidateSchema(sinkDBName, "drift_target")
+
+	if err := withTx(func(tx *sql.Tx) error {
+		return HandleResolvedLine(tx, ResolvedLine{endpoint: "drift", database: sinkDBName, nanos: 1, logical: 0})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err = getPreviousResolvedDB(db, "drift", sinkDBName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.nanos != 1 {
+		t.Fatalf("expected resolved row to advance to nanos=1, got %d", resolved.nanos)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// SourceConnector produces batches of mutations destined for an
+// endpoint's database, paired with the ResolvedLine that should be
+// recorded once those mutations have been applied. It is the extension
+// point that lets cdc-sink ingest from sources other than a CockroachDB
+// changefeed webhook.
+type SourceConnector interface {
+	// Next blocks until the next batch is available. A batch may carry
+	// mutations, a resolved line, or both; callers should treat a nil
+	// mutations slice or a zero-valued ResolvedLine as "nothing new on
+	// that front this round".
+	Next(ctx context.Context) (mutations []Mutation, resolved ResolvedLine, err error)
+}
+
+// CRDBConnector implements SourceConnector over the JSON lines delivered
+// by a CockroachDB changefeed webhook: each line is either a mutation
+// row or a {"resolved": ...} line, and parseResolvedLine/parseMutationLine
+// tell them apart.
+type CRDBConnector struct {
+	endpoint string
+	database string
+	table    string
+	lines    chan []byte
+}
+
+// NewCRDBConnector returns a CRDBConnector for the given endpoint,
+// database, and table. The HTTP webhook handler should call Push for
+// every line it receives; Next drains them in order.
+func NewCRDBConnector(endpoint, database, table string) *CRDBConnector {
+	return &CRDBConnector{
+		endpoint: endpoint,
+		database: database,
+		table:    table,
+		lines:    make(chan []byte, 1024),
+	}
+}
+
+// Push enqueues a raw line received from the changefeed webhook.
+func (c *CRDBConnector) Push(line []byte) {
+	c.lines <- line
+}
+
+// Next implements SourceConnector.
+func (c *CRDBConnector) Next(ctx context.Context) ([]Mutation, ResolvedLine, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ResolvedLine{}, ctx.Err()
+	case line := <-c.lines:
+		if rl, err := parseResolvedLine(line, c.endpoint, c.database); err == nil {
+			return nil, rl, nil
+		}
+		m, err := parseMutationLine(line, c.endpoint, c.database, c.table)
+		if err != nil {
+			return nil, ResolvedLine{}, err
+		}
+		return []Mutation{m}, ResolvedLine{}, nil
+	}
+}
+
+// parseMutationLine parses a single non-resolved line of a CockroachDB
+// changefeed webhook payload into a Mutation destined for table. A line
+// whose "after" is the JSON literal null represents a delete of "key",
+// as CockroachDB changefeeds emit for deleted rows.
+func parseMutationLine(line []byte, endpoint, database, table string) (Mutation, error) {
+	var payload struct {
+		After json.RawMessage `json:"after"`
+		Key   json.RawMessage `json:"key"`
+	}
+	if err := json.Unmarshal(line, &payload); err != nil {
+		return Mutation{}, fmt.Errorf("could not parse mutation line: %w", err)
+	}
+	if payload.Key == nil {
+		return Mutation{}, fmt.Errorf("mutation line missing key field")
+	}
+
+	if len(payload.After) == 0 || string(payload.After) == "null" {
+		return Mutation{
+			endpoint: endpoint,
+			database: database,
+			table:    table,
+			key:      string(payload.Key),
+			deleted:  true,
+		}, nil
+	}
+
+	return Mutation{
+		endpoint: endpoint,
+		database: database,
+		table:    table,
+		key:      string(payload.Key),
+		value:    payload.After,
+	}, nil
+}
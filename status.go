@@ -0,0 +1,130 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// resolvedLagSeconds tracks how far behind wall-clock time each
+	// endpoint/database's last applied resolved timestamp is.
+	resolvedLagSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cdc_sink_resolved_lag_seconds",
+		Help: "Wall-clock seconds between now and the last resolved timestamp applied.",
+	}, []string{"endpoint", "database"})
+
+	// resolvedNanos tracks the nanos component of the last resolved
+	// timestamp applied for each endpoint/database.
+	resolvedNanos = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cdc_sink_resolved_nanos",
+		Help: "The nanos component of the last resolved timestamp applied.",
+	}, []string{"endpoint", "database"})
+)
+
+func init() {
+	prometheus.MustRegister(resolvedLagSeconds, resolvedNanos)
+}
+
+// updateResolvedMetrics refreshes the Prometheus gauges for rl. It is
+// called on every successful writeUpdated so that the gauges always
+// reflect the last resolved row actually persisted.
+func updateResolvedMetrics(rl ResolvedLine) {
+	resolvedNanos.WithLabelValues(rl.endpoint, rl.database).Set(float64(rl.nanos))
+	lag := time.Since(time.Unix(0, rl.nanos)).Seconds()
+	resolvedLagSeconds.WithLabelValues(rl.endpoint, rl.database).Set(lag)
+}
+
+// pausedEndpoints records the schema-drift reason an (endpoint, database)
+// pair is currently paused for, if any. It is consulted by the status
+// endpoint and kept up to date by HandleResolvedLine.
+var pausedEndpoints = struct {
+	sync.Mutex
+	reason map[databaseKey]string
+}{reason: make(map[databaseKey]string)}
+
+// markPaused records why (endpoint, database) is paused.
+func markPaused(endpoint, database, reason string) {
+	pausedEndpoints.Lock()
+	defer pausedEndpoints.Unlock()
+	pausedEndpoints.reason[databaseKey{endpoint: endpoint, database: database}] = reason
+}
+
+// clearPaused clears any paused reason recorded for (endpoint, database).
+func clearPaused(endpoint, database string) {
+	pausedEndpoints.Lock()
+	defer pausedEndpoints.Unlock()
+	delete(pausedEndpoints.reason, databaseKey{endpoint: endpoint, database: database})
+}
+
+// pausedReason returns the reason (endpoint, database) is paused, and
+// whether it is paused at all.
+func pausedReason(endpoint, database string) (string, bool) {
+	pausedEndpoints.Lock()
+	defer pausedEndpoints.Unlock()
+	reason, ok := pausedEndpoints.reason[databaseKey{endpoint: endpoint, database: database}]
+	return reason, ok
+}
+
+// statusEntry is the per-endpoint JSON shape returned by StatusHandler.
+type statusEntry struct {
+	Endpoint     string  `json:"endpoint"`
+	Database     string  `json:"database"`
+	Nanos        int64   `json:"nanos"`
+	Logical      int     `json:"logical"`
+	LagSeconds   float64 `json:"lag_seconds"`
+	Paused       bool    `json:"paused"`
+	PausedReason string  `json:"paused_reason,omitempty"`
+}
+
+// StatusHandler returns an http.HandlerFunc for /_/status that reports
+// resolved-timestamp progress for every endpoint/database pair recorded
+// in db.
+func StatusHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var rows []ResolvedLine
+		if err := crdb.ExecuteTx(context.Background(), db, nil, func(tx *sql.Tx) error {
+			var err error
+			rows, err = getAllResolved(tx)
+			return err
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		entries := make([]statusEntry, 0, len(rows))
+		for _, rl := range rows {
+			entry := statusEntry{
+				Endpoint:   rl.endpoint,
+				Database:   rl.database,
+				Nanos:      rl.nanos,
+				Logical:    rl.logical,
+				LagSeconds: time.Since(time.Unix(0, rl.nanos)).Seconds(),
+			}
+			if reason, ok := pausedReason(rl.endpoint, rl.database); ok {
+				entry.Paused = true
+				entry.PausedReason = reason
+			}
+			entries = append(entries, entry)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
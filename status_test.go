@@ -0,0 +1,86 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestStatusAndMetricsReflectResolvedTable drives the same 2-endpoint,
+// 20-update scenario TestResolvedTable exercises and asserts that both
+// the /_/status JSON and the Prometheus gauges reflect the final
+// resolved position for each endpoint.
+func TestStatusAndMetricsReflectResolvedTable(t *testing.T) {
+	db, _, dbClose := getDB(t)
+	defer dbClose()
+
+	createSinkDB(t, db)
+	defer dropSinkDB(t, db)
+
+	if err := CreateResolvedTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	for i := 0; i < 10; i++ {
+		rl := ResolvedLine{endpoint: "one", database: "db", nanos: now + int64(i), logical: i}
+		if err := rl.writeUpdatedDB(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		rl := ResolvedLine{endpoint: "two", database: "db", nanos: now + int64(i), logical: i}
+		if err := rl.writeUpdatedDB(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/_/status", nil)
+	rec := httptest.NewRecorder()
+	StatusHandler(db)(rec, req)
+
+	var entries []statusEntry
+	if err := json.Unmarshal(rec.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 status entries, got %d", len(entries))
+	}
+
+	byEndpoint := make(map[string]statusEntry, len(entries))
+	for _, e := range entries {
+		byEndpoint[e.Endpoint] = e
+	}
+	for _, endpoint := range []string{"one", "two"} {
+		entry, ok := byEndpoint[endpoint]
+		if !ok {
+			t.Fatalf("missing status entry for endpoint %q", endpoint)
+		}
+		if entry.Nanos != now+9 || entry.Logical != 9 {
+			t.Errorf("endpoint %q: expected nanos=%d logical=9, got nanos=%d logical=%d",
+				endpoint, now+9, entry.Nanos, entry.Logical)
+		}
+		if entry.Paused {
+			t.Errorf("endpoint %q: expected not paused", endpoint)
+		}
+
+		gauge := resolvedNanos.WithLabelValues(endpoint, "db")
+		if got := testutil.ToFloat64(gauge); got != float64(now+9) {
+			t.Errorf("endpoint %q: expected cdc_sink_resolved_nanos=%d, got %v", endpoint, now+9, got)
+		}
+	}
+}
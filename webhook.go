@@ -0,0 +1,100 @@
+// Copyright 2020 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/cockroach-go/crdb"
+)
+
+// connectors caches one CRDBConnector per (endpoint, database, table)
+// path the webhook handler has seen, so that repeated posts to the same
+// path are drained by a single long-lived dispatcher instead of
+// spawning a new one per request.
+var connectors sync.Map // map[string]*CRDBConnector
+
+// connectorFor returns the CRDBConnector for endpoint/database/table,
+// creating it and starting its dispatcher goroutine on first use.
+func connectorFor(db *sql.DB, endpoint, database, table string) *CRDBConnector {
+	key := strings.Join([]string{endpoint, database, table}, "/")
+	if c, ok := connectors.Load(key); ok {
+		return c.(*CRDBConnector)
+	}
+
+	connector := NewCRDBConnector(endpoint, database, table)
+	actual, loaded := connectors.LoadOrStore(key, connector)
+	if loaded {
+		return actual.(*CRDBConnector)
+	}
+
+	go dispatch(db, connector)
+	return actual.(*CRDBConnector)
+}
+
+// dispatch drains connector for the lifetime of the process, staging
+// each mutation it produces and handling each resolved line it produces.
+func dispatch(db *sql.DB, connector *CRDBConnector) {
+	ctx := context.Background()
+	for {
+		mutations, resolved, err := connector.Next(ctx)
+		if err != nil {
+			log.Printf("cdc-sink: connector for %s/%s error: %s", connector.endpoint, connector.database, err)
+			continue
+		}
+
+		err = crdb.ExecuteTx(ctx, db, nil, func(tx *sql.Tx) error {
+			for _, m := range mutations {
+				if err := stageMutation(tx, m); err != nil {
+					return err
+				}
+			}
+			if resolved.endpoint != "" {
+				return HandleResolvedLine(tx, resolved)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("cdc-sink: applying batch for %s/%s: %s", connector.endpoint, connector.database, err)
+		}
+	}
+}
+
+// changefeedHandler accepts a CockroachDB changefeed webhook payload
+// posted to /<endpoint>/<database>/<table>: a stream of ndjson lines,
+// each either a mutation or a {"resolved": ...} line.
+func changefeedHandler(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) != 3 {
+			http.Error(w, "expected path /<endpoint>/<database>/<table>", http.StatusBadRequest)
+			return
+		}
+		connector := connectorFor(db, parts[0], parts[1], parts[2])
+
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			connector.Push(append([]byte(nil), line...))
+		}
+		if err := scanner.Err(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}